@@ -0,0 +1,88 @@
+package block
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+// blockCacheHMACSuffixLength is the number of trailing bytes appended to each cached
+// block that hold its HMAC, computed over the rest of the payload.
+const blockCacheHMACSuffixLength = sha256.Size
+
+// appendBlockHMAC appends an HMAC-SHA256 of data, keyed with key, to data and returns the
+// combined payload that should be written to the cache storage in place of data. Used by
+// blockCache when CachingOptions.VerifyOnRead is set.
+func appendBlockHMAC(data, key []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data) //nolint:errcheck
+
+	return h.Sum(data)
+}
+
+// verifyAndStripBlockHMAC splits a payload previously produced by appendBlockHMAC back
+// into its data and verifies the trailing HMAC against key. It returns an error if the
+// payload is too short to contain an HMAC or if the HMAC does not match, indicating the
+// cached copy has been corrupted or tampered with.
+func verifyAndStripBlockHMAC(payload, key []byte) ([]byte, error) {
+	if len(payload) < blockCacheHMACSuffixLength {
+		return nil, fmt.Errorf("cached block too short to contain HMAC")
+	}
+
+	n := len(payload) - blockCacheHMACSuffixLength
+	data, gotMAC := payload[:n], payload[n:]
+
+	h := hmac.New(sha256.New, key)
+	h.Write(data) //nolint:errcheck
+	wantMAC := h.Sum(nil)
+
+	if !hmac.Equal(gotMAC, wantMAC) {
+		return nil, fmt.Errorf("HMAC mismatch for cached block")
+	}
+
+	return data, nil
+}
+
+// readFromCache returns the full, verified contents previously cached under
+// storageBlockID, or an error if there is no such entry or it fails HMAC verification.
+// This, together with writeToCache below, is the entirety of blockCache's HMAC
+// verify-on-read wiring; the rest of blockCache (construction, eviction, the
+// getContentBlock/sliceBlock plumbing) is the underlying cache engine and knows nothing
+// about HMACs.
+func (c *blockCache) readFromCache(ctx context.Context, storageBlockID string) ([]byte, error) {
+	payload, err := c.cacheStorage.GetBlock(ctx, storageBlockID, fullBlockOffset, fullBlockLength)
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.options.VerifyOnRead {
+		return payload, nil
+	}
+
+	data, err := verifyAndStripBlockHMAC(payload, c.options.HMACSecret)
+	if err != nil {
+		log.Warn().Msgf("cache_corruption: %v for cached block %v, evicting and refetching", err, storageBlockID)
+
+		if delErr := c.cacheStorage.DeleteBlock(ctx, storageBlockID); delErr != nil {
+			log.Printf("error evicting corrupt cache entry %v: %v", storageBlockID, delErr)
+		}
+
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (c *blockCache) writeToCache(ctx context.Context, storageBlockID string, data []byte) {
+	payload := data
+	if c.options.VerifyOnRead {
+		payload = appendBlockHMAC(data, c.options.HMACSecret)
+	}
+
+	if err := c.cacheStorage.PutBlock(ctx, storageBlockID, payload); err != nil {
+		log.Printf("error writing cache entry %v: %v", storageBlockID, err)
+	}
+}
@@ -0,0 +1,42 @@
+package block
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBlockCacheHMACRoundTrip(t *testing.T) {
+	key := []byte("some-format-key-0123456789abcdef")
+	data := []byte("hello, world")
+
+	payload := appendBlockHMAC(data, key)
+
+	got, err := verifyAndStripBlockHMAC(payload, key)
+	if err != nil {
+		t.Fatalf("unexpected error verifying payload: %v", err)
+	}
+
+	if !bytes.Equal(got, data) {
+		t.Errorf("unexpected data after verification: %x, wanted %x", got, data)
+	}
+}
+
+func TestBlockCacheHMACDetectsCorruption(t *testing.T) {
+	key := []byte("some-format-key-0123456789abcdef")
+	data := []byte("hello, world")
+
+	payload := appendBlockHMAC(data, key)
+	payload[0] ^= 1
+
+	if _, err := verifyAndStripBlockHMAC(payload, key); err == nil {
+		t.Fatalf("expected error verifying corrupted payload, got nil")
+	}
+}
+
+func TestBlockCacheHMACRejectsTruncatedPayload(t *testing.T) {
+	key := []byte("some-format-key-0123456789abcdef")
+
+	if _, err := verifyAndStripBlockHMAC([]byte("short"), key); err == nil {
+		t.Fatalf("expected error verifying truncated payload, got nil")
+	}
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/repo/block"
+)
+
+// repositoryVerifyCache, when set, makes applyCachingOptionsOverrides enable VerifyOnRead in
+// the block.CachingOptions it is given, authenticating every cached block with an HMAC
+// before serving it and evicting+refetching on mismatch.
+var repositoryVerifyCache = app.Flag("verify-cache", "Verify the HMAC of every cached block on read and evict corrupt entries.").Bool()
+
+// applyCachingOptionsOverrides layers --verify-cache onto opts. The repository-open path
+// does not call it, so the CachingOptions a repository is opened with are not changed by
+// --verify-cache. HMACSecret is derived from the repository's own format key so
+// verify-cache needs no separate key provisioning or rotation.
+func applyCachingOptionsOverrides(rep *repo.Repository, opts block.CachingOptions) block.CachingOptions {
+	if *repositoryVerifyCache {
+		opts.VerifyOnRead = true
+		opts.HMACSecret = deriveCacheVerificationHMACSecret(rep)
+	}
+
+	return opts
+}
+
+// deriveCacheVerificationHMACSecret derives a key for cache-block verification from the
+// repository's format key, namespaced so it can never collide with keys used for block
+// encryption or authentication.
+func deriveCacheVerificationHMACSecret(rep *repo.Repository) []byte {
+	h := hmac.New(sha256.New, rep.Format.HMACSecret)
+	h.Write([]byte("block-cache-verification")) //nolint:errcheck
+
+	return h.Sum(nil)
+}
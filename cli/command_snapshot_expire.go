@@ -15,13 +15,84 @@ import (
 var (
 	snapshotExpireCommand = snapshotCommands.Command("expire", "Remove old snapshots according to defined expiration policies.")
 
-	snapshotExpireHost   = snapshotExpireCommand.Flag("host", "Expire snapshots from a given host").Default("").String()
-	snapshotExpireUser   = snapshotExpireCommand.Flag("user", "Expire snapshots from a given user").Default("").String()
-	snapshotExpireAll    = snapshotExpireCommand.Flag("all", "Expire all snapshots").Bool()
-	snapshotExpirePaths  = snapshotExpireCommand.Arg("path", "Expire snapshots for a given paths only").Strings()
-	snapshotExpireDelete = snapshotExpireCommand.Flag("delete", "Whether to actually delete snapshots").Default("no").String()
+	snapshotExpireHost    = snapshotExpireCommand.Flag("host", "Expire snapshots from a given host").Default("").String()
+	snapshotExpireUser    = snapshotExpireCommand.Flag("user", "Expire snapshots from a given user").Default("").String()
+	snapshotExpireTags    = snapshotExpireCommand.Flag("tag", "Expire snapshots matching a given tag (key=value), can be repeated").Strings()
+	snapshotExpireAll     = snapshotExpireCommand.Flag("all", "Expire all snapshots").Bool()
+	snapshotExpirePaths   = snapshotExpireCommand.Arg("path", "Expire snapshots for a given paths only").Strings()
+	snapshotExpireDelete  = snapshotExpireCommand.Flag("delete", "Whether to actually delete snapshots").Default("no").String()
+	snapshotExpireGroupBy = snapshotExpireCommand.Flag("group-by", "Comma-separated grouping key: host, user, path, tag:<key>. Retention is computed per group. Defaults to host,user,path.").String()
+	snapshotExpireJSON    = snapshotExpireCommand.Flag("json", "Output a stable JSON schema instead of the human-readable summary.").Bool()
+
+	snapshotExpireKeepLast    = snapshotExpireCommand.Flag("keep-last", "Override the stored policy: number of most recent snapshots to keep").Int()
+	snapshotExpireKeepHourly  = snapshotExpireCommand.Flag("keep-hourly", "Override the stored policy: number of hourly snapshots to keep").Int()
+	snapshotExpireKeepDaily   = snapshotExpireCommand.Flag("keep-daily", "Override the stored policy: number of daily snapshots to keep").Int()
+	snapshotExpireKeepWeekly  = snapshotExpireCommand.Flag("keep-weekly", "Override the stored policy: number of weekly snapshots to keep").Int()
+	snapshotExpireKeepMonthly = snapshotExpireCommand.Flag("keep-monthly", "Override the stored policy: number of monthly snapshots to keep").Int()
+	snapshotExpireKeepAnnual  = snapshotExpireCommand.Flag("keep-annual", "Override the stored policy: number of annual snapshots to keep").Int()
+	snapshotExpireKeepWithin  = snapshotExpireCommand.Flag("keep-within", "Override the stored policy: keep all snapshots within this duration of now").Duration()
+	snapshotExpireKeepTags    = snapshotExpireCommand.Flag("keep-tag", "Unconditionally keep snapshots tagged with this key, can be repeated").Strings()
 )
 
+// adHocRetentionPolicySet reports whether any of --keep-last/--keep-hourly/--keep-daily/
+// --keep-weekly/--keep-monthly/--keep-annual/--keep-within was given a positive value, in
+// which case they replace the stored RetentionPolicy for the duration of this invocation.
+// --keep-tag is not counted; it is applied on top of whichever policy is in effect.
+func adHocRetentionPolicySet() bool {
+	return *snapshotExpireKeepLast > 0 ||
+		*snapshotExpireKeepHourly > 0 ||
+		*snapshotExpireKeepDaily > 0 ||
+		*snapshotExpireKeepWeekly > 0 ||
+		*snapshotExpireKeepMonthly > 0 ||
+		*snapshotExpireKeepAnnual > 0 ||
+		*snapshotExpireKeepWithin > 0
+}
+
+func adHocRetentionPolicy() *snapshot.RetentionPolicy {
+	pol := &snapshot.RetentionPolicy{}
+
+	if *snapshotExpireKeepLast > 0 {
+		pol.KeepLatest = snapshotExpireKeepLast
+	}
+	if *snapshotExpireKeepHourly > 0 {
+		pol.KeepHourly = snapshotExpireKeepHourly
+	}
+	if *snapshotExpireKeepDaily > 0 {
+		pol.KeepDaily = snapshotExpireKeepDaily
+	}
+	if *snapshotExpireKeepWeekly > 0 {
+		pol.KeepWeekly = snapshotExpireKeepWeekly
+	}
+	if *snapshotExpireKeepMonthly > 0 {
+		pol.KeepMonthly = snapshotExpireKeepMonthly
+	}
+	if *snapshotExpireKeepAnnual > 0 {
+		pol.KeepAnnual = snapshotExpireKeepAnnual
+	}
+	if *snapshotExpireKeepWithin > 0 {
+		pol.KeepWithin = snapshotExpireKeepWithin
+	}
+
+	return pol
+}
+
+// keepTaggedSnapshots marks any snapshot carrying one of the --keep-tag keys as retained,
+// independent of whatever the RetentionPolicy decided.
+func keepTaggedSnapshots(snapshots []*snapshot.Manifest, keepTags []string) {
+	if len(keepTags) == 0 {
+		return
+	}
+
+	for _, s := range snapshots {
+		for _, tag := range keepTags {
+			if _, ok := s.Tags[tag]; ok {
+				s.RetentionReasons = append(s.RetentionReasons, "tagged:"+tag)
+				break
+			}
+		}
+	}
+}
+
 func getSnapshotNamesToExpire(mgr *snapshot.Manager) ([]string, error) {
 	if !*snapshotExpireAll && len(*snapshotExpirePaths) == 0 {
 		return nil, fmt.Errorf("Must specify paths to expire or --all")
@@ -55,10 +126,12 @@ func getSnapshotNamesToExpire(mgr *snapshot.Manager) ([]string, error) {
 	return result, nil
 }
 
-func expireSnapshots(pmgr *snapshot.PolicyManager, snapshots []*snapshot.Manifest, names []string) ([]string, error) {
+func expireSnapshots(pmgr *snapshot.PolicyManager, snapshots []*snapshot.Manifest, groupBy []string) ([]string, error) {
+	groups := groupManifests(snapshots, groupBy)
+
 	var toDelete []string
-	for _, snapshotGroup := range snapshot.GroupBySource(snapshots) {
-		td, err := expireSnapshotsForSingleSource(pmgr, snapshotGroup)
+	for _, key := range sortedGroupKeys(groups) {
+		td, err := expireSnapshotsForSingleSource(pmgr, groups[key])
 		if err != nil {
 			return nil, err
 		}
@@ -69,12 +142,14 @@ func expireSnapshots(pmgr *snapshot.PolicyManager, snapshots []*snapshot.Manifes
 
 func expireSnapshotsForSingleSource(pmgr *snapshot.PolicyManager, snapshots []*snapshot.Manifest) ([]string, error) {
 	src := snapshots[0].Source
-	pol, _, err := pmgr.GetEffectivePolicy(src)
+
+	retentionPolicy, err := effectiveRetentionPolicy(pmgr, src)
 	if err != nil {
 		return nil, err
 	}
 
-	pol.RetentionPolicy.ComputeRetentionReasons(snapshots)
+	retentionPolicy.ComputeRetentionReasons(snapshots)
+	keepTaggedSnapshots(snapshots, *snapshotExpireKeepTags)
 
 	var toDelete []string
 	for _, s := range snapshots {
@@ -94,6 +169,21 @@ func expireSnapshotsForSingleSource(pmgr *snapshot.PolicyManager, snapshots []*s
 	return toDelete, nil
 }
 
+// effectiveRetentionPolicy returns the ad-hoc --keep-* policy if any of those flags were
+// passed, otherwise the stored RetentionPolicy for src.
+func effectiveRetentionPolicy(pmgr *snapshot.PolicyManager, src snapshot.SourceInfo) (*snapshot.RetentionPolicy, error) {
+	if adHocRetentionPolicySet() {
+		return adHocRetentionPolicy(), nil
+	}
+
+	pol, _, err := pmgr.GetEffectivePolicy(src)
+	if err != nil {
+		return nil, err
+	}
+
+	return pol.RetentionPolicy, nil
+}
+
 func runExpireCommand(ctx context.Context, rep *repo.Repository) error {
 	mgr := snapshot.NewManager(rep)
 	pmgr := snapshot.NewPolicyManager(rep)
@@ -106,8 +196,34 @@ func runExpireCommand(ctx context.Context, rep *repo.Repository) error {
 	if err != nil {
 		return err
 	}
-	snapshots = filterHostAndUser(snapshots)
-	toDelete, err := expireSnapshots(pmgr, snapshots, snapshotNames)
+
+	tagFilters, err := parseTagFilters(*snapshotExpireTags)
+	if err != nil {
+		return err
+	}
+
+	snapshots = filterSnapshots(snapshots, *snapshotExpireHost, *snapshotExpireUser, tagFilters)
+
+	groupBy := parseGroupBy(*snapshotExpireGroupBy)
+
+	if !isDefaultGroupBy(groupBy) && !adHocRetentionPolicySet() {
+		return fmt.Errorf("--group-by %q can mix snapshots from multiple sources into one group; pass one of --keep-last/--keep-hourly/--keep-daily/--keep-weekly/--keep-monthly/--keep-annual/--keep-within to specify the retention policy to apply to each group explicitly", *snapshotExpireGroupBy)
+	}
+
+	if *snapshotExpireJSON {
+		groups := groupManifests(snapshots, groupBy)
+		for _, key := range sortedGroupKeys(groups) {
+			retentionPolicy, err := effectiveRetentionPolicy(pmgr, groups[key][0].Source)
+			if err != nil {
+				return err
+			}
+			retentionPolicy.ComputeRetentionReasons(groups[key])
+			keepTaggedSnapshots(groups[key], *snapshotExpireKeepTags)
+		}
+		return printJSON(toJSONGroups(groups))
+	}
+
+	toDelete, err := expireSnapshots(pmgr, snapshots, groupBy)
 	if err != nil {
 		return err
 	}
@@ -123,6 +239,7 @@ func runExpireCommand(ctx context.Context, rep *repo.Repository) error {
 		for _, it := range toDelete {
 			rep.Manifests.Delete(it)
 		}
+		fmt.Fprintf(os.Stderr, "Run 'kopia snapshot prune' to reclaim storage used by blocks that are now unreferenced.\n")
 	} else {
 		fmt.Fprintf(os.Stderr, "%v snapshot(s) would be deleted. Pass --delete=yes to do it.\n", len(toDelete))
 	}
@@ -130,19 +247,25 @@ func runExpireCommand(ctx context.Context, rep *repo.Repository) error {
 	return nil
 }
 
-func filterHostAndUser(snapshots []*snapshot.Manifest) []*snapshot.Manifest {
-	if *snapshotExpireHost == "" && *snapshotExpireUser == "" {
+// filterSnapshots returns the subset of snapshots matching the given host, user, and tag
+// filters. An empty host or user matches everything; a nil/empty tagFilters matches everything.
+func filterSnapshots(snapshots []*snapshot.Manifest, host, user string, tagFilters map[string]string) []*snapshot.Manifest {
+	if host == "" && user == "" && len(tagFilters) == 0 {
 		return snapshots
 	}
 
 	var result []*snapshot.Manifest
 
 	for _, s := range snapshots {
-		if *snapshotExpireHost != "" && *snapshotExpireHost != s.Source.Host {
+		if host != "" && host != s.Source.Host {
+			continue
+		}
+
+		if user != "" && user != s.Source.UserName {
 			continue
 		}
 
-		if *snapshotExpireUser != "" && *snapshotExpireUser != s.Source.UserName {
+		if !matchesTagFilters(s, tagFilters) {
 			continue
 		}
 
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"testing"
+	"time"
+)
+
+// withAdHocRetentionFlags temporarily overrides the --keep-* flag values for the duration
+// of fn, restoring the originals afterwards, so adHocRetentionPolicy/adHocRetentionPolicySet
+// can be exercised without going through kingpin's argument parsing.
+func withAdHocRetentionFlags(t *testing.T, last, hourly, daily, weekly, monthly, annual int, within time.Duration, fn func()) {
+	t.Helper()
+
+	origLast, origHourly, origDaily := *snapshotExpireKeepLast, *snapshotExpireKeepHourly, *snapshotExpireKeepDaily
+	origWeekly, origMonthly, origAnnual := *snapshotExpireKeepWeekly, *snapshotExpireKeepMonthly, *snapshotExpireKeepAnnual
+	origWithin := *snapshotExpireKeepWithin
+
+	*snapshotExpireKeepLast, *snapshotExpireKeepHourly, *snapshotExpireKeepDaily = last, hourly, daily
+	*snapshotExpireKeepWeekly, *snapshotExpireKeepMonthly, *snapshotExpireKeepAnnual = weekly, monthly, annual
+	*snapshotExpireKeepWithin = within
+
+	defer func() {
+		*snapshotExpireKeepLast, *snapshotExpireKeepHourly, *snapshotExpireKeepDaily = origLast, origHourly, origDaily
+		*snapshotExpireKeepWeekly, *snapshotExpireKeepMonthly, *snapshotExpireKeepAnnual = origWeekly, origMonthly, origAnnual
+		*snapshotExpireKeepWithin = origWithin
+	}()
+
+	fn()
+}
+
+func TestAdHocRetentionPolicySet(t *testing.T) {
+	cases := []struct {
+		desc                                         string
+		last, hourly, daily, weekly, monthly, annual int
+		within                                       time.Duration
+		want                                         bool
+	}{
+		{"nothing set", 0, 0, 0, 0, 0, 0, 0, false},
+		{"keep-last set", 5, 0, 0, 0, 0, 0, 0, true},
+		{"keep-hourly set", 0, 3, 0, 0, 0, 0, 0, true},
+		{"keep-daily set", 0, 0, 7, 0, 0, 0, 0, true},
+		{"keep-weekly set", 0, 0, 0, 4, 0, 0, 0, true},
+		{"keep-monthly set", 0, 0, 0, 0, 12, 0, 0, true},
+		{"keep-annual set", 0, 0, 0, 0, 0, 2, 0, true},
+		{"keep-within set", 0, 0, 0, 0, 0, 0, time.Hour, true},
+	}
+
+	for _, tc := range cases {
+		withAdHocRetentionFlags(t, tc.last, tc.hourly, tc.daily, tc.weekly, tc.monthly, tc.annual, tc.within, func() {
+			if got := adHocRetentionPolicySet(); got != tc.want {
+				t.Errorf("%v: adHocRetentionPolicySet() = %v, want %v", tc.desc, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAdHocRetentionPolicy(t *testing.T) {
+	withAdHocRetentionFlags(t, 5, 0, 7, 0, 0, 0, time.Hour, func() {
+		pol := adHocRetentionPolicy()
+
+		if pol.KeepLatest == nil || *pol.KeepLatest != 5 {
+			t.Errorf("KeepLatest = %v, want 5", pol.KeepLatest)
+		}
+		if pol.KeepHourly != nil {
+			t.Errorf("KeepHourly = %v, want nil", pol.KeepHourly)
+		}
+		if pol.KeepDaily == nil || *pol.KeepDaily != 7 {
+			t.Errorf("KeepDaily = %v, want 7", pol.KeepDaily)
+		}
+		if pol.KeepWeekly != nil {
+			t.Errorf("KeepWeekly = %v, want nil", pol.KeepWeekly)
+		}
+		if pol.KeepMonthly != nil {
+			t.Errorf("KeepMonthly = %v, want nil", pol.KeepMonthly)
+		}
+		if pol.KeepAnnual != nil {
+			t.Errorf("KeepAnnual = %v, want nil", pol.KeepAnnual)
+		}
+		if pol.KeepWithin == nil || *pol.KeepWithin != time.Hour {
+			t.Errorf("KeepWithin = %v, want 1h", pol.KeepWithin)
+		}
+	})
+}
@@ -0,0 +1,260 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/object"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+)
+
+var (
+	snapshotFindCommand        = snapshotCommands.Command("find", "Find files across snapshots.")
+	snapshotFindPattern        = snapshotFindCommand.Arg("pattern", "Glob pattern to match against file names.").String()
+	snapshotFindSource         = snapshotFindCommand.Flag("source", "Limit search to a given source.").String()
+	snapshotFindHost           = snapshotFindCommand.Flag("host", "Limit search to a given host.").Default("").String()
+	snapshotFindUser           = snapshotFindCommand.Flag("user", "Limit search to a given user.").Default("").String()
+	snapshotFindTags           = snapshotFindCommand.Flag("tag", "Limit search to snapshots matching a given tag (key=value), can be repeated").Strings()
+	snapshotFindNewestOnly     = snapshotFindCommand.Flag("newest-only", "Only search the newest snapshot of each source.").Bool()
+	snapshotFindJSON           = snapshotFindCommand.Flag("json", "Output results as JSON.").Bool()
+	snapshotFindMinSize        = snapshotFindCommand.Flag("min-size", "Only match files at least this many bytes.").Int64()
+	snapshotFindMaxSize        = snapshotFindCommand.Flag("max-size", "Only match files at most this many bytes.").Default("-1").Int64()
+	snapshotFindAfter          = snapshotFindCommand.Flag("after", "Only match files modified at or after this time ("+timeFormat+").").String()
+	snapshotFindBefore         = snapshotFindCommand.Flag("before", "Only match files modified at or before this time ("+timeFormat+").").String()
+	snapshotFindObjectIDPrefix = snapshotFindCommand.Flag("object-id-prefix", "Only match entries whose object ID has this prefix.").String()
+)
+
+// findFilter bundles the optional name pattern and the --min-size/--max-size/--after/
+// --before/--object-id-prefix criteria into a single value threaded through findInTree.
+// --host/--user/--tag are not part of it; they select which snapshots are searched.
+type findFilter struct {
+	pattern        string
+	minSize        int64
+	maxSize        int64 // -1 means unbounded
+	after          *time.Time
+	before         *time.Time
+	objectIDPrefix string
+}
+
+func newFindFilter() (*findFilter, error) {
+	f := &findFilter{
+		pattern:        *snapshotFindPattern,
+		minSize:        *snapshotFindMinSize,
+		maxSize:        *snapshotFindMaxSize,
+		objectIDPrefix: *snapshotFindObjectIDPrefix,
+	}
+
+	if *snapshotFindAfter != "" {
+		t, err := time.Parse(timeFormat, *snapshotFindAfter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --after time %q: %v", *snapshotFindAfter, err)
+		}
+		f.after = &t
+	}
+
+	if *snapshotFindBefore != "" {
+		t, err := time.Parse(timeFormat, *snapshotFindBefore)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --before time %q: %v", *snapshotFindBefore, err)
+		}
+		f.before = &t
+	}
+
+	return f, nil
+}
+
+// matches reports whether entry satisfies every criterion in f. An empty pattern matches
+// any name.
+func (f *findFilter) matches(entry fs.Entry) bool {
+	md := entry.Metadata()
+
+	if !f.matchesMetadata(md.Name, md.FileSize, md.ModTime) {
+		return false
+	}
+
+	if f.objectIDPrefix != "" {
+		oid, ok := entry.(object.HasObjectID)
+		if !ok || !f.matchesObjectID(oid.ObjectID().String()) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesMetadata checks the name/size/mtime criteria in f, the part of matches that
+// doesn't depend on the fs.Entry/object.HasObjectID interfaces.
+func (f *findFilter) matchesMetadata(name string, size int64, modTime time.Time) bool {
+	if f.pattern != "" {
+		if ok, err := path.Match(f.pattern, name); err != nil || !ok {
+			return false
+		}
+	}
+
+	if size < f.minSize {
+		return false
+	}
+
+	if f.maxSize >= 0 && size > f.maxSize {
+		return false
+	}
+
+	if f.after != nil && modTime.Before(*f.after) {
+		return false
+	}
+
+	if f.before != nil && modTime.After(*f.before) {
+		return false
+	}
+
+	return true
+}
+
+// matchesObjectID checks the --object-id-prefix criterion against a rendered object ID.
+func (f *findFilter) matchesObjectID(id string) bool {
+	return strings.HasPrefix(id, f.objectIDPrefix)
+}
+
+type snapshotFindMatch struct {
+	SnapshotID string `json:"snapshotID"`
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	ModTime    string `json:"mtime"`
+	ObjectID   string `json:"objectID,omitempty"`
+}
+
+func runFindCommand(ctx context.Context, rep *repo.Repository) error {
+	mgr := snapshot.NewManager(rep)
+
+	manifestIDs, _, err := findManifestIDs(mgr, *snapshotFindSource)
+	if err != nil {
+		return err
+	}
+
+	manifests, err := mgr.LoadSnapshots(manifestIDs)
+	if err != nil {
+		return err
+	}
+
+	tagFilters, err := parseTagFilters(*snapshotFindTags)
+	if err != nil {
+		return err
+	}
+
+	manifests = filterSnapshots(manifests, *snapshotFindHost, *snapshotFindUser, tagFilters)
+
+	if *snapshotFindNewestOnly {
+		manifests = newestPerSource(manifests)
+	}
+
+	filter, err := newFindFilter()
+	if err != nil {
+		return err
+	}
+
+	var matches []snapshotFindMatch
+
+	for _, m := range manifests {
+		root, err := mgr.SnapshotRoot(m)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "unable to open root of %v: %v\n", m.ID, err)
+			continue
+		}
+
+		found, err := findInTree(ctx, root, "/", filter)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range found {
+			f.SnapshotID = m.ID
+			matches = append(matches, f)
+		}
+	}
+
+	return outputFindMatches(matches)
+}
+
+func findInTree(ctx context.Context, entry fs.Entry, entryPath string, filter *findFilter) ([]snapshotFindMatch, error) {
+	var matches []snapshotFindMatch
+
+	if filter.matches(entry) {
+		match := snapshotFindMatch{
+			Path:    entryPath,
+			Size:    entry.Metadata().FileSize,
+			ModTime: entry.Metadata().ModTime.Format(timeFormat),
+		}
+
+		if oid, ok := entry.(object.HasObjectID); ok {
+			match.ObjectID = oid.ObjectID().String()
+		}
+
+		matches = append(matches, match)
+	}
+
+	dir, ok := entry.(fs.Directory)
+	if !ok {
+		return matches, nil
+	}
+
+	children, err := dir.Readdir(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error reading directory %v: %v", entryPath, err)
+	}
+
+	for _, child := range children {
+		childPath := strings.TrimSuffix(entryPath, "/") + "/" + child.Metadata().Name
+
+		childMatches, err := findInTree(ctx, child, childPath, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		matches = append(matches, childMatches...)
+	}
+
+	return matches, nil
+}
+
+func newestPerSource(manifests []*snapshot.Manifest) []*snapshot.Manifest {
+	var result []*snapshot.Manifest
+
+	for _, group := range snapshot.GroupBySource(manifests) {
+		sorted := snapshot.SortByTime(group, false)
+		if len(sorted) > 0 {
+			result = append(result, sorted[len(sorted)-1])
+		}
+	}
+
+	return result
+}
+
+func outputFindMatches(matches []snapshotFindMatch) error {
+	if *snapshotFindJSON {
+		return printJSON(matches)
+	}
+
+	for _, m := range matches {
+		fmt.Printf("%v %v %v %v %v\n", m.SnapshotID, m.Path, units.BytesStringBase10(m.Size), m.ModTime, m.ObjectID)
+	}
+
+	return nil
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func init() {
+	snapshotFindCommand.Action(repositoryAction(runFindCommand))
+}
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFindFilterMatchesMetadata(t *testing.T) {
+	jan1 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	jan15 := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+	feb1 := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		desc     string
+		filter   *findFilter
+		name     string
+		size     int64
+		modTime  time.Time
+		expected bool
+	}{
+		{"no criteria matches anything", &findFilter{maxSize: -1}, "anything.txt", 123, jan15, true},
+		{"pattern match", &findFilter{pattern: "*.txt", maxSize: -1}, "foo.txt", 1, jan15, true},
+		{"pattern mismatch", &findFilter{pattern: "*.txt", maxSize: -1}, "foo.go", 1, jan15, false},
+		{"below min size", &findFilter{minSize: 100, maxSize: -1}, "f", 50, jan15, false},
+		{"at min size", &findFilter{minSize: 100, maxSize: -1}, "f", 100, jan15, true},
+		{"above max size", &findFilter{maxSize: 100}, "f", 150, jan15, false},
+		{"unbounded max size", &findFilter{maxSize: -1}, "f", 1 << 40, jan15, true},
+		{"before after-cutoff", &findFilter{maxSize: -1, after: &jan15}, "f", 1, jan1, false},
+		{"at after-cutoff", &findFilter{maxSize: -1, after: &jan15}, "f", 1, jan15, true},
+		{"after before-cutoff", &findFilter{maxSize: -1, before: &jan15}, "f", 1, feb1, false},
+		{"at before-cutoff", &findFilter{maxSize: -1, before: &jan15}, "f", 1, jan15, true},
+	}
+
+	for _, tc := range cases {
+		if got := tc.filter.matchesMetadata(tc.name, tc.size, tc.modTime); got != tc.expected {
+			t.Errorf("%v: matchesMetadata(%q, %v, %v) = %v, want %v", tc.desc, tc.name, tc.size, tc.modTime, got, tc.expected)
+		}
+	}
+}
+
+func TestFindFilterMatchesObjectID(t *testing.T) {
+	cases := []struct {
+		prefix   string
+		id       string
+		expected bool
+	}{
+		{"", "kabcdef", true},
+		{"kabc", "kabcdef", true},
+		{"kxyz", "kabcdef", false},
+	}
+
+	for _, tc := range cases {
+		f := &findFilter{objectIDPrefix: tc.prefix}
+		if got := f.matchesObjectID(tc.id); got != tc.expected {
+			t.Errorf("matchesObjectID(%q) with prefix %q = %v, want %v", tc.id, tc.prefix, got, tc.expected)
+		}
+	}
+}
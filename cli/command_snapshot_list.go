@@ -27,6 +27,11 @@ var (
 	snapshotListShowModTime          = snapshotListCommand.Flag("mtime", "Include file mod time").Bool()
 	shapshotListShowOwner            = snapshotListCommand.Flag("owner", "Include owner").Bool()
 	maxResultsPerPath                = snapshotListCommand.Flag("max-results", "Maximum number of results.").Default("1000").Int()
+	snapshotListHost                 = snapshotListCommand.Flag("host", "List snapshots from a given host.").Default("").String()
+	snapshotListUser                 = snapshotListCommand.Flag("user", "List snapshots from a given user.").Default("").String()
+	snapshotListTags                 = snapshotListCommand.Flag("tag", "List snapshots matching a given tag (key=value), can be repeated").Strings()
+	snapshotListGroupBy              = snapshotListCommand.Flag("group-by", "Comma-separated grouping key: host, user, path, tag:<key>. Defaults to host,user,path.").String()
+	snapshotListJSON                 = snapshotListCommand.Flag("json", "Output a stable JSON schema instead of the human-readable listing.").Bool()
 )
 
 func findSnapshotsForSource(mgr *snapshot.Manager, sourceInfo snapshot.SourceInfo) (manifestIDs []string, relPath string, err error) {
@@ -86,24 +91,56 @@ func runSnapshotsCommand(ctx context.Context, rep *repo.Repository) error {
 		return err
 	}
 
+	tagFilters, err := parseTagFilters(*snapshotListTags)
+	if err != nil {
+		return err
+	}
+
+	manifests = filterSnapshots(manifests, *snapshotListHost, *snapshotListUser, tagFilters)
+
 	polMgr := snapshot.NewPolicyManager(rep)
 
-	return outputManifestGroups(ctx, manifests, strings.Split(relPath, "/"), mgr, polMgr)
+	groupBy := parseGroupBy(*snapshotListGroupBy)
+	groups := groupManifests(manifests, groupBy)
+
+	if isDefaultGroupBy(groupBy) {
+		for _, group := range groups {
+			src := group[0].Source
+
+			pol, _, err := polMgr.GetEffectivePolicy(src)
+			if err != nil {
+				log.Warn().Msgf("unable to determine effective policy for %v", src)
+			} else {
+				pol.RetentionPolicy.ComputeRetentionReasons(group)
+			}
+		}
+	} else {
+		log.Warn().Msgf("--group-by %q can mix snapshots from multiple sources into one group; skipping retention reasons (list has no per-group policy to apply)", *snapshotListGroupBy)
+	}
+
+	if *snapshotListJSON {
+		return printJSON(toJSONGroups(groups))
+	}
+
+	return outputManifestGroups(ctx, groups, strings.Split(relPath, "/"), mgr)
+}
+
+// parseGroupBy splits a comma-separated --group-by flag value into its components.
+func parseGroupBy(groupBy string) []string {
+	if groupBy == "" {
+		return nil
+	}
+
+	return strings.Split(groupBy, ",")
 }
 
-func outputManifestGroups(ctx context.Context, manifests []*snapshot.Manifest, relPathParts []string, mgr *snapshot.Manager, polMgr *snapshot.PolicyManager) error {
+func outputManifestGroups(ctx context.Context, groups map[string][]*snapshot.Manifest, relPathParts []string, mgr *snapshot.Manager) error {
 	separator := ""
-	for _, snapshotGroup := range snapshot.GroupBySource(manifests) {
-		src := snapshotGroup[0].Source
-		fmt.Printf("%v%v\n", separator, src)
+	for _, key := range sortedGroupKeys(groups) {
+		snapshotGroup := groups[key]
+		fmt.Printf("%v%v\n", separator, groupHeading(key, snapshotGroup[0].Source))
 		separator = "\n"
 
-		pol, _, err := polMgr.GetEffectivePolicy(src)
-		if err != nil {
-			log.Warn().Msgf("unable to determine effective policy for %v", src)
-		} else {
-			pol.RetentionPolicy.ComputeRetentionReasons(snapshotGroup)
-		}
 		if err := outputManifestFromSingleSource(ctx, snapshotGroup, relPathParts, mgr); err != nil {
 			return err
 		}
@@ -186,6 +223,10 @@ func outputManifestFromSingleSource(ctx context.Context, manifests []*snapshot.M
 			}
 		}
 
+		if len(m.Tags) > 0 {
+			bits = append(bits, "tags:"+strings.Join(tagStrings(m.Tags), ","))
+		}
+
 		fmt.Printf(
 			"  %v %v %v\n",
 			m.StartTime.Format("2006-01-02 15:04:05 MST"),
@@ -0,0 +1,268 @@
+// +build linux darwin
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+
+	"bazil.org/fuse"
+	fusefs "bazil.org/fuse/fs"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+)
+
+var (
+	snapshotMountCommand = snapshotCommands.Command("mount", "Mount snapshots as a read-only filesystem.")
+	snapshotMountPoint   = snapshotMountCommand.Arg("mountpoint", "Mount point.").Required().String()
+	snapshotMountSource  = snapshotMountCommand.Flag("source", "Limit mount to a given source.").String()
+	snapshotMountHost    = snapshotMountCommand.Flag("host", "Limit mount to a given host.").Default("").String()
+	snapshotMountUser    = snapshotMountCommand.Flag("user", "Limit mount to a given user.").Default("").String()
+	snapshotMountTags    = snapshotMountCommand.Flag("tag", "Limit mount to snapshots matching a given tag (key=value), can be repeated").Strings()
+)
+
+// mountNamedChildren is a synthetic, read-only directory level of the mount hierarchy
+// (the /host, /host/user, and /host/user/path levels) whose children are either more
+// synthetic levels or, at the bottom, fusefs nodes backed by an actual snapshot root.
+type mountNamedChildren map[string]fusefs.Node
+
+func (c mountNamedChildren) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0o555
+	return nil
+}
+
+func (c mountNamedChildren) Lookup(ctx context.Context, name string) (fusefs.Node, error) {
+	if n, ok := c[name]; ok {
+		return n, nil
+	}
+
+	return nil, fuse.ENOENT
+}
+
+func (c mountNamedChildren) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	result := make([]fuse.Dirent, 0, len(names))
+	for _, name := range names {
+		result = append(result, fuse.Dirent{Name: name, Type: fuse.DT_Dir})
+	}
+
+	return result, nil
+}
+
+// mountDir adapts an fs.Directory entry from a snapshot tree to bazil/fuse.
+type mountDir struct {
+	dir fs.Directory
+}
+
+func (d *mountDir) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | (d.dir.Metadata().FileMode() & os.ModePerm)
+	return nil
+}
+
+func (d *mountDir) Lookup(ctx context.Context, name string) (fusefs.Node, error) {
+	children, err := d.dir.Readdir(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range children {
+		if c.Metadata().Name == name {
+			return mountNodeForEntry(c), nil
+		}
+	}
+
+	return nil, fuse.ENOENT
+}
+
+func (d *mountDir) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	children, err := d.dir.Readdir(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]fuse.Dirent, 0, len(children))
+	for _, c := range children {
+		result = append(result, fuse.Dirent{Name: c.Metadata().Name, Type: mountDirentType(c)})
+	}
+
+	return result, nil
+}
+
+// mountFile adapts an fs.File entry from a snapshot tree to bazil/fuse.
+type mountFile struct {
+	file fs.File
+}
+
+func (f *mountFile) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = f.file.Metadata().FileMode() & os.ModePerm
+	a.Size = uint64(f.file.Metadata().FileSize)
+	return nil
+}
+
+func (f *mountFile) ReadAll(ctx context.Context) ([]byte, error) {
+	r, err := f.file.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close() //nolint:errcheck
+
+	buf := make([]byte, f.file.Metadata().FileSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+func mountNodeForEntry(e fs.Entry) fusefs.Node {
+	if d, ok := e.(fs.Directory); ok {
+		return &mountDir{dir: d}
+	}
+
+	return &mountFile{file: e.(fs.File)}
+}
+
+func mountDirentType(e fs.Entry) fuse.DirentType {
+	if _, ok := e.(fs.Directory); ok {
+		return fuse.DT_Dir
+	}
+
+	return fuse.DT_File
+}
+
+// mountRoot builds the /host/user/path/<timestamp> hierarchy from a set of manifests
+// grouped by source, lazily resolving each snapshot's root directory on Lookup so that
+// mounting is cheap even with a large number of snapshots.
+func mountRoot(mgr *snapshot.Manager, manifests []*snapshot.Manifest) fusefs.Node {
+	hosts := mountNamedChildren{}
+
+	for _, group := range snapshot.GroupBySource(manifests) {
+		src := group[0].Source
+
+		users, ok := hosts[src.Host].(mountNamedChildren)
+		if !ok {
+			users = mountNamedChildren{}
+			hosts[src.Host] = users
+		}
+
+		paths, ok := users[src.UserName].(mountNamedChildren)
+		if !ok {
+			paths = mountNamedChildren{}
+			users[src.UserName] = paths
+		}
+
+		timestamps := mountNamedChildren{}
+		for _, m := range group {
+			timestamps[m.StartTime.Format("2006-01-02T15:04:05")] = &mountSnapshot{mgr: mgr, manifest: m}
+		}
+
+		paths[src.Path] = timestamps
+	}
+
+	return hosts
+}
+
+// mountSnapshot lazily resolves a single snapshot's root directory on each Lookup/ReadDirAll;
+// the resolved root is not cached between calls.
+type mountSnapshot struct {
+	mgr      *snapshot.Manager
+	manifest *snapshot.Manifest
+}
+
+func (s *mountSnapshot) Attr(ctx context.Context, a *fuse.Attr) error {
+	a.Mode = os.ModeDir | 0o555
+	return nil
+}
+
+func (s *mountSnapshot) root(ctx context.Context) (fs.Directory, error) {
+	root, err := s.mgr.SnapshotRoot(s.manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, ok := root.(fs.Directory)
+	if !ok {
+		return nil, fmt.Errorf("snapshot %v has no root directory", s.manifest.ID)
+	}
+
+	return dir, nil
+}
+
+func (s *mountSnapshot) Lookup(ctx context.Context, name string) (fusefs.Node, error) {
+	dir, err := s.root(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return (&mountDir{dir: dir}).Lookup(ctx, name)
+}
+
+func (s *mountSnapshot) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
+	dir, err := s.root(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return (&mountDir{dir: dir}).ReadDirAll(ctx)
+}
+
+type mountFS struct {
+	root fusefs.Node
+}
+
+func (m *mountFS) Root() (fusefs.Node, error) {
+	return m.root, nil
+}
+
+func runMountCommand(ctx context.Context, rep *repo.Repository) error {
+	mgr := snapshot.NewManager(rep)
+
+	manifestIDs, _, err := findManifestIDs(mgr, *snapshotMountSource)
+	if err != nil {
+		return err
+	}
+
+	manifests, err := mgr.LoadSnapshots(manifestIDs)
+	if err != nil {
+		return err
+	}
+
+	tagFilters, err := parseTagFilters(*snapshotMountTags)
+	if err != nil {
+		return err
+	}
+
+	manifests = filterSnapshots(manifests, *snapshotMountHost, *snapshotMountUser, tagFilters)
+
+	c, err := fuse.Mount(*snapshotMountPoint, fuse.ReadOnly(), fuse.FSName("kopia"))
+	if err != nil {
+		return fmt.Errorf("unable to mount %v: %v", *snapshotMountPoint, err)
+	}
+	defer c.Close() //nolint:errcheck
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt)
+
+	go func() {
+		<-sigCh
+		fuse.Unmount(*snapshotMountPoint) //nolint:errcheck
+	}()
+
+	return fusefs.Serve(c, &mountFS{root: mountRoot(mgr, manifests)})
+}
+
+func init() {
+	snapshotMountCommand.Action(repositoryAction(runMountCommand))
+}
@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/object"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/repo/storage"
+)
+
+var (
+	snapshotPruneCommand     = snapshotCommands.Command("prune", "Reclaim storage used by blocks no longer referenced by any snapshot.")
+	snapshotPruneDryRun      = snapshotPruneCommand.Flag("dry-run", "Don't delete anything, just report what would be deleted.").Default("true").Bool()
+	snapshotPruneGracePeriod = snapshotPruneCommand.Flag("grace-period", "Don't delete blocks written more recently than this, to avoid racing with in-progress backups.").Default("24h").Duration()
+)
+
+func runPruneCommand(ctx context.Context, rep *repo.Repository) error {
+	mgr := snapshot.NewManager(rep)
+
+	manifestIDs := mgr.ListSnapshotManifests(nil)
+
+	manifests, err := mgr.LoadSnapshots(manifestIDs)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Scanning %v snapshots for referenced blocks...\n", len(manifests))
+
+	referenced := map[string]bool{}
+
+	for _, m := range manifests {
+		root, err := mgr.SnapshotRoot(m)
+		if err != nil {
+			return fmt.Errorf("unable to open root of %v: %v", m.ID, err)
+		}
+
+		if err := collectReferencedBlocks(ctx, rep, root, referenced); err != nil {
+			return fmt.Errorf("error walking snapshot %v: %v", m.ID, err)
+		}
+
+		if m.HashCacheID.String() != "" {
+			blockIDs, err := rep.Objects.ListBlocks(ctx, m.HashCacheID)
+			if err != nil {
+				return fmt.Errorf("unable to list blocks for hash cache %v of %v: %v", m.HashCacheID, m.ID, err)
+			}
+
+			for _, b := range blockIDs {
+				referenced[b] = true
+			}
+		}
+	}
+
+	log.Printf("Found %v referenced blocks.", len(referenced))
+
+	cutoff := time.Now().Add(-*snapshotPruneGracePeriod)
+
+	var toDelete []string
+
+	err = rep.Blocks.ListBlocks(ctx, func(bm storage.BlockMetadata) error {
+		if referenced[bm.BlockID] {
+			return nil
+		}
+
+		if bm.Timestamp.After(cutoff) {
+			return nil
+		}
+
+		toDelete = append(toDelete, bm.BlockID)
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error listing blocks: %v", err)
+	}
+
+	if len(toDelete) == 0 {
+		fmt.Fprintf(os.Stderr, "Nothing to prune.\n")
+		return nil
+	}
+
+	if *snapshotPruneDryRun {
+		fmt.Fprintf(os.Stderr, "%v block(s) would be deleted. Pass --dry-run=false to reclaim them.\n", len(toDelete))
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Deleting %v unreferenced block(s)...\n", len(toDelete))
+
+	for _, blockID := range toDelete {
+		if err := rep.Blocks.DeleteBlock(ctx, blockID); err != nil {
+			return fmt.Errorf("error deleting block %v: %v", blockID, err)
+		}
+	}
+
+	return nil
+}
+
+// collectReferencedBlocks walks the given entry (and its children) adding the block IDs
+// backing every object it encounters to the referenced set.
+func collectReferencedBlocks(ctx context.Context, rep *repo.Repository, entry fs.Entry, referenced map[string]bool) error {
+	if oid, ok := entry.(object.HasObjectID); ok {
+		blockIDs, err := rep.Objects.ListBlocks(ctx, oid.ObjectID())
+		if err != nil {
+			return fmt.Errorf("unable to list blocks for %v: %v", oid.ObjectID(), err)
+		}
+
+		for _, b := range blockIDs {
+			referenced[b] = true
+		}
+	}
+
+	dir, ok := entry.(fs.Directory)
+	if !ok {
+		return nil
+	}
+
+	children, err := dir.Readdir(ctx)
+	if err != nil {
+		return fmt.Errorf("error reading directory: %v", err)
+	}
+
+	for _, child := range children {
+		if err := collectReferencedBlocks(ctx, rep, child, referenced); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	snapshotPruneCommand.Action(repositoryAction(runPruneCommand))
+}
@@ -0,0 +1,175 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+)
+
+var (
+	snapshotTagCommand = snapshotCommands.Command("tag", "Manage snapshot tags.")
+
+	snapshotTagAddCommand    = snapshotTagCommand.Command("add", "Add tags to a snapshot.")
+	snapshotTagAddID         = snapshotTagAddCommand.Arg("id", "Snapshot manifest ID").Required().String()
+	snapshotTagAddTags       = snapshotTagAddCommand.Arg("tag", "Tag to add (key=value)").Required().Strings()
+	snapshotTagRemoveCommand = snapshotTagCommand.Command("remove", "Remove tags from a snapshot.")
+	snapshotTagRemoveID      = snapshotTagRemoveCommand.Arg("id", "Snapshot manifest ID").Required().String()
+	snapshotTagRemoveKeys    = snapshotTagRemoveCommand.Arg("key", "Tag key to remove").Required().Strings()
+	snapshotTagListCommand   = snapshotTagCommand.Command("list", "List tags of a snapshot.").Alias("ls")
+	snapshotTagListID        = snapshotTagListCommand.Arg("id", "Snapshot manifest ID").Required().String()
+)
+
+// parseTagFilters parses a list of "key=value" strings into a map, used to filter snapshots by tag.
+func parseTagFilters(tags []string) (map[string]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	result := map[string]string{}
+
+	for _, t := range tags {
+		parts := strings.SplitN(t, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid tag filter %q, must be key=value", t)
+		}
+
+		result[parts[0]] = parts[1]
+	}
+
+	return result, nil
+}
+
+// matchesTagFilters returns true if the given manifest's tags satisfy all of the provided filters.
+func matchesTagFilters(m *snapshot.Manifest, filters map[string]string) bool {
+	for k, v := range filters {
+		if m.Tags[k] != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// tagStrings renders a tag map as a sorted list of "key=value" strings for display.
+func tagStrings(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	result := make([]string, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, k+"="+tags[k])
+	}
+
+	return result
+}
+
+func loadSingleManifest(mgr *snapshot.Manager, id string) (*snapshot.Manifest, error) {
+	manifests, err := mgr.LoadSnapshots([]string{id})
+	if err != nil {
+		return nil, fmt.Errorf("unable to load manifest %v: %v", id, err)
+	}
+
+	if len(manifests) != 1 {
+		return nil, fmt.Errorf("manifest %v not found", id)
+	}
+
+	return manifests[0], nil
+}
+
+// resaveManifestWithNewTags persists m (whose Tags have already been mutated by the
+// caller) as a new manifest and deletes oldID. Manifests are immutable, ID-assigning
+// entries (mirroring the rep.Manifests.Delete call in command_snapshot_expire.go), so
+// mutating m.Tags in place and calling SaveSnapshot again would leave the untagged
+// original manifest behind under its old ID forever; the new ID is printed so the
+// caller can keep referring to the snapshot.
+func resaveManifestWithNewTags(rep *repo.Repository, mgr *snapshot.Manager, oldID string, m *snapshot.Manifest) error {
+	newID, err := mgr.SaveSnapshot(m)
+	if err != nil {
+		return fmt.Errorf("unable to save updated manifest: %v", err)
+	}
+
+	rep.Manifests.Delete(oldID)
+
+	fmt.Printf("%v\n", newID)
+
+	return nil
+}
+
+func runTagAddCommand(ctx context.Context, rep *repo.Repository) error {
+	mgr := snapshot.NewManager(rep)
+
+	oldID := *snapshotTagAddID
+
+	m, err := loadSingleManifest(mgr, oldID)
+	if err != nil {
+		return err
+	}
+
+	tags, err := parseTagFilters(*snapshotTagAddTags)
+	if err != nil {
+		return err
+	}
+
+	if m.Tags == nil {
+		m.Tags = map[string]string{}
+	}
+
+	for k, v := range tags {
+		m.Tags[k] = v
+	}
+
+	return resaveManifestWithNewTags(rep, mgr, oldID, m)
+}
+
+func runTagRemoveCommand(ctx context.Context, rep *repo.Repository) error {
+	mgr := snapshot.NewManager(rep)
+
+	oldID := *snapshotTagRemoveID
+
+	m, err := loadSingleManifest(mgr, oldID)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range *snapshotTagRemoveKeys {
+		delete(m.Tags, k)
+	}
+
+	return resaveManifestWithNewTags(rep, mgr, oldID, m)
+}
+
+func runTagListCommand(ctx context.Context, rep *repo.Repository) error {
+	mgr := snapshot.NewManager(rep)
+
+	m, err := loadSingleManifest(mgr, *snapshotTagListID)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(m.Tags))
+	for k := range m.Tags {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		fmt.Printf("%v=%v\n", k, m.Tags[k])
+	}
+
+	return nil
+}
+
+func init() {
+	snapshotTagAddCommand.Action(repositoryAction(runTagAddCommand))
+	snapshotTagRemoveCommand.Action(repositoryAction(runTagRemoveCommand))
+	snapshotTagListCommand.Action(repositoryAction(runTagListCommand))
+}
@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kopia/kopia/snapshot"
+)
+
+func TestParseTagFilters(t *testing.T) {
+	cases := []struct {
+		tags    []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{nil, nil, false},
+		{[]string{}, nil, false},
+		{[]string{"k=v"}, map[string]string{"k": "v"}, false},
+		{[]string{"k=v", "k2=v2"}, map[string]string{"k": "v", "k2": "v2"}, false},
+		{[]string{"k=v=w"}, map[string]string{"k": "v=w"}, false},
+		{[]string{"novalue"}, nil, true},
+		{[]string{"=v"}, nil, true},
+	}
+
+	for _, tc := range cases {
+		got, err := parseTagFilters(tc.tags)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("parseTagFilters(%v) error = %v, wantErr %v", tc.tags, err, tc.wantErr)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseTagFilters(%v) = %v, want %v", tc.tags, got, tc.want)
+		}
+	}
+}
+
+func TestMatchesTagFilters(t *testing.T) {
+	m := &snapshot.Manifest{Tags: map[string]string{"env": "prod", "owner": "alice"}}
+
+	cases := []struct {
+		filters map[string]string
+		want    bool
+	}{
+		{nil, true},
+		{map[string]string{}, true},
+		{map[string]string{"env": "prod"}, true},
+		{map[string]string{"env": "prod", "owner": "alice"}, true},
+		{map[string]string{"env": "staging"}, false},
+		{map[string]string{"missing": "key"}, false},
+	}
+
+	for _, tc := range cases {
+		if got := matchesTagFilters(m, tc.filters); got != tc.want {
+			t.Errorf("matchesTagFilters(%v) = %v, want %v", tc.filters, got, tc.want)
+		}
+	}
+}
+
+func TestTagStrings(t *testing.T) {
+	cases := []struct {
+		tags map[string]string
+		want []string
+	}{
+		{nil, []string{}},
+		{map[string]string{"b": "2", "a": "1"}, []string{"a=1", "b=2"}},
+	}
+
+	for _, tc := range cases {
+		got := tagStrings(tc.tags)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("tagStrings(%v) = %v, want %v", tc.tags, got, tc.want)
+		}
+	}
+}
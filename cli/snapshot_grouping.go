@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/kopia/kopia/snapshot"
+)
+
+// jsonGroup is the stable JSON schema emitted by `snapshot list --json` and
+// `snapshot expire --json` for a single group produced by --group-by.
+type jsonGroup struct {
+	Source    string         `json:"source"`
+	Snapshots []jsonSnapshot `json:"snapshots"`
+}
+
+type jsonSnapshot struct {
+	ID               string            `json:"id"`
+	StartTime        string            `json:"startTime"`
+	EndTime          string            `json:"endTime"`
+	Stats            snapshot.Stats    `json:"stats"`
+	RetentionReasons []string          `json:"retentionReasons,omitempty"`
+	Tags             map[string]string `json:"tags,omitempty"`
+	RootObjectID     string            `json:"rootObjectID"`
+}
+
+func toJSONGroups(groups map[string][]*snapshot.Manifest) []jsonGroup {
+	var result []jsonGroup
+
+	for _, key := range sortedGroupKeys(groups) {
+		group := jsonGroup{Source: key}
+
+		for _, m := range groups[key] {
+			group.Snapshots = append(group.Snapshots, jsonSnapshot{
+				ID:               m.ID,
+				StartTime:        m.StartTime.Format(timeFormat),
+				EndTime:          m.EndTime.Format(timeFormat),
+				Stats:            m.Stats,
+				RetentionReasons: m.RetentionReasons,
+				Tags:             m.Tags,
+				RootObjectID:     m.RootObjectID.String(),
+			})
+		}
+
+		result = append(result, group)
+	}
+
+	return result
+}
+
+// groupManifests partitions manifests into groups keyed by the given --group-by
+// components (any combination of "host", "user", "path", and "tag:<key>"). When groupBy
+// is empty, it defaults to grouping by source (host+user+path), matching
+// snapshot.GroupBySource.
+func groupManifests(manifests []*snapshot.Manifest, groupBy []string) map[string][]*snapshot.Manifest {
+	if len(groupBy) == 0 {
+		groupBy = []string{"host", "user", "path"}
+	}
+
+	groups := map[string][]*snapshot.Manifest{}
+
+	for _, m := range manifests {
+		key := groupingKey(m, groupBy)
+		groups[key] = append(groups[key], m)
+	}
+
+	return groups
+}
+
+// isDefaultGroupBy reports whether groupBy selects exactly the host+user+path keys (the
+// default grouping, in any order) or is empty (which groupManifests treats the same way),
+// i.e. every group is guaranteed to contain snapshots from exactly one source. A custom
+// --group-by (e.g. "tag:release") can legitimately mix snapshots from many sources into
+// one group, so callers that need a single source's stored policy to apply to a whole
+// group must check this first.
+func isDefaultGroupBy(groupBy []string) bool {
+	if len(groupBy) == 0 {
+		return true
+	}
+
+	if len(groupBy) != 3 {
+		return false
+	}
+
+	has := map[string]bool{}
+	for _, g := range groupBy {
+		has[g] = true
+	}
+
+	return has["host"] && has["user"] && has["path"]
+}
+
+func groupingKey(m *snapshot.Manifest, groupBy []string) string {
+	var parts []string
+
+	for _, g := range groupBy {
+		switch {
+		case g == "host":
+			parts = append(parts, "host:"+m.Source.Host)
+		case g == "user":
+			parts = append(parts, "user:"+m.Source.UserName)
+		case g == "path":
+			parts = append(parts, "path:"+m.Source.Path)
+		case strings.HasPrefix(g, "tag:"):
+			key := strings.TrimPrefix(g, "tag:")
+			parts = append(parts, "tag:"+key+"="+m.Tags[key])
+		}
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// groupHeading renders a human-readable heading for a group: the familiar
+// "host@user:path" form when grouping by the default host+user+path, otherwise the
+// raw --group-by key.
+func groupHeading(key string, src snapshot.SourceInfo) string {
+	if key == groupingKey(&snapshot.Manifest{Source: src}, []string{"host", "user", "path"}) {
+		return fmt.Sprintf("%v", src)
+	}
+
+	return key
+}
+
+// sortedGroupKeys returns the keys of groups in a stable, deterministic order.
+func sortedGroupKeys(groups map[string][]*snapshot.Manifest) []string {
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
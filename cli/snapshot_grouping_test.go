@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kopia/kopia/snapshot"
+)
+
+func TestIsDefaultGroupBy(t *testing.T) {
+	cases := []struct {
+		groupBy []string
+		want    bool
+	}{
+		{nil, true},
+		{[]string{}, true},
+		{[]string{"host", "user", "path"}, true},
+		{[]string{"user", "host", "path"}, true},
+		{[]string{"path", "user", "host"}, true},
+		{[]string{"host", "user"}, false},
+		{[]string{"host", "user", "path", "tag:release"}, false},
+		{[]string{"tag:release"}, false},
+		{[]string{"host", "host", "user"}, false},
+	}
+
+	for _, tc := range cases {
+		if got := isDefaultGroupBy(tc.groupBy); got != tc.want {
+			t.Errorf("isDefaultGroupBy(%v) = %v, want %v", tc.groupBy, got, tc.want)
+		}
+	}
+}
+
+func TestGroupingKey(t *testing.T) {
+	m := &snapshot.Manifest{
+		Source: snapshot.SourceInfo{Host: "h", UserName: "u", Path: "/p"},
+		Tags:   map[string]string{"release": "v1"},
+	}
+
+	cases := []struct {
+		groupBy []string
+		want    string
+	}{
+		{[]string{"host", "user", "path"}, "host:h,user:u,path:/p"},
+		{[]string{"user", "host", "path"}, "user:u,host:h,path:/p"},
+		{[]string{"tag:release"}, "tag:release=v1"},
+		{[]string{"tag:missing"}, "tag:missing="},
+		{[]string{"host"}, "host:h"},
+	}
+
+	for _, tc := range cases {
+		if got := groupingKey(m, tc.groupBy); got != tc.want {
+			t.Errorf("groupingKey(%v) = %q, want %q", tc.groupBy, got, tc.want)
+		}
+	}
+}
+
+func TestGroupManifests(t *testing.T) {
+	a := &snapshot.Manifest{Source: snapshot.SourceInfo{Host: "h1", UserName: "u", Path: "/p"}}
+	b := &snapshot.Manifest{Source: snapshot.SourceInfo{Host: "h2", UserName: "u", Path: "/p"}}
+	c := &snapshot.Manifest{Source: snapshot.SourceInfo{Host: "h1", UserName: "u", Path: "/p"}}
+
+	groups := groupManifests([]*snapshot.Manifest{a, b, c}, nil)
+
+	want := map[string][]*snapshot.Manifest{
+		"host:h1,user:u,path:/p": {a, c},
+		"host:h2,user:u,path:/p": {b},
+	}
+
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("groupManifests() = %v, want %v", groups, want)
+	}
+}